@@ -0,0 +1,121 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// ErrInvalidToken 表示傳入的 JWT 無法驗證簽章或已過期。
+var ErrInvalidToken = errors.New("auth: invalid or expired token")
+
+// Claims 是驗證通過後從 JWT payload 取出的使用者資訊。
+type Claims struct {
+	Name      string   `json:"name"`  // 使用者名稱，作為 clientName 使用
+	Rooms     []string `json:"rooms"` // token 夾帶的房間清單；只會被解析，不會用來限制 join_room
+	ExpiresAt int64    `json:"exp"`   // Unix 時間戳，過期時間
+}
+
+// TokenVerifier 驗證升級請求夾帶的 token 並回傳其宣告內容。
+type TokenVerifier interface {
+	Verify(token string) (Claims, error)
+}
+
+// HMACTokenVerifier 是使用單一共享密鑰以 HMAC-SHA256 簽章的 JWT 驗證器，
+// 僅支援 "HS256" alg，足以應付自家前後端共用密鑰的場景。
+type HMACTokenVerifier struct {
+	Secret []byte // 簽章密鑰
+}
+
+// NewHMACTokenVerifierFromEnv 從環境變數 WS_CHAT_JWT_SECRET 讀取密鑰建立驗證器，
+// 密鑰未設定時回傳 nil，呼叫端應視為「關閉驗證」或自行報錯，依部署情境決定。
+func NewHMACTokenVerifierFromEnv() *HMACTokenVerifier {
+	secret := os.Getenv("WS_CHAT_JWT_SECRET")
+	if secret == "" {
+		return nil
+	}
+	return &HMACTokenVerifier{Secret: []byte(secret)}
+}
+
+// Verify 解析並驗證一個 HS256 JWT，成功時回傳其 Claims。
+func (v *HMACTokenVerifier) Verify(token string) (Claims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return Claims{}, ErrInvalidToken
+	}
+
+	signingInput := parts[0] + "." + parts[1]
+	expected := hmacSign(signingInput, v.Secret)
+	got, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil || subtle.ConstantTimeCompare(expected, got) != 1 {
+		return Claims{}, ErrInvalidToken
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return Claims{}, ErrInvalidToken
+	}
+	var claims Claims
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return Claims{}, ErrInvalidToken
+	}
+	if claims.ExpiresAt != 0 && time.Now().Unix() > claims.ExpiresAt {
+		return Claims{}, ErrInvalidToken
+	}
+	if claims.Name == "" {
+		return Claims{}, ErrInvalidToken
+	}
+	return claims, nil
+}
+
+func hmacSign(input string, secret []byte) []byte {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(input))
+	return mac.Sum(nil)
+}
+
+// tokenFromRequest 依序嘗試從 Sec-WebSocket-Protocol 標頭與 ?token= 查詢參數取出 JWT。
+func tokenFromRequest(r *http.Request) string {
+	if proto := r.Header.Get("Sec-WebSocket-Protocol"); proto != "" {
+		// 前端可能送多個以逗號分隔的子協定，token 慣例放在第一個
+		return strings.TrimSpace(strings.Split(proto, ",")[0])
+	}
+	return r.URL.Query().Get("token")
+}
+
+// OriginAllowlist 檢查升級請求的 Origin 標頭是否在允許清單內。
+type OriginAllowlist struct {
+	allowed map[string]bool
+}
+
+// NewOriginAllowlistFromEnv 從環境變數 WS_CHAT_ALLOWED_ORIGINS（逗號分隔）建立允許清單，
+// 未設定時回傳一個允許所有來源的清單，方便本機開發。
+func NewOriginAllowlistFromEnv() *OriginAllowlist {
+	raw := os.Getenv("WS_CHAT_ALLOWED_ORIGINS")
+	if raw == "" {
+		return &OriginAllowlist{allowed: nil}
+	}
+	allowed := make(map[string]bool)
+	for _, origin := range strings.Split(raw, ",") {
+		origin = strings.TrimSpace(origin)
+		if origin != "" {
+			allowed[origin] = true
+		}
+	}
+	return &OriginAllowlist{allowed: allowed}
+}
+
+// Allowed 回報 origin 是否可以升級成 WebSocket 連線。
+func (o *OriginAllowlist) Allowed(origin string) bool {
+	if o == nil || o.allowed == nil {
+		return true // 未配置允許清單時維持目前的開發模式行為
+	}
+	return o.allowed[origin]
+}
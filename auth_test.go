@@ -0,0 +1,71 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func signTestToken(t *testing.T, secret []byte, claims Claims) string {
+	t.Helper()
+	header := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"HS256","typ":"JWT"}`))
+	payloadBytes, err := json.Marshal(claims)
+	if err != nil {
+		t.Fatalf("marshaling claims: %v", err)
+	}
+	payload := base64.RawURLEncoding.EncodeToString(payloadBytes)
+	signingInput := header + "." + payload
+	sig := base64.RawURLEncoding.EncodeToString(hmacSign(signingInput, secret))
+	return signingInput + "." + sig
+}
+
+func TestHMACTokenVerifierAcceptsValidToken(t *testing.T) {
+	secret := []byte("test-secret")
+	v := &HMACTokenVerifier{Secret: secret}
+	token := signTestToken(t, secret, Claims{Name: "alice"})
+
+	claims, err := v.Verify(token)
+	if err != nil {
+		t.Fatalf("expected valid token to verify, got %v", err)
+	}
+	if claims.Name != "alice" {
+		t.Fatalf("expected claims.Name %q, got %q", "alice", claims.Name)
+	}
+}
+
+func TestHMACTokenVerifierRejectsWrongSecret(t *testing.T) {
+	v := &HMACTokenVerifier{Secret: []byte("correct-secret")}
+	token := signTestToken(t, []byte("wrong-secret"), Claims{Name: "alice"})
+
+	if _, err := v.Verify(token); err == nil {
+		t.Fatal("expected verification to fail with a mismatched secret")
+	}
+}
+
+func TestHMACTokenVerifierRejectsExpiredToken(t *testing.T) {
+	secret := []byte("test-secret")
+	v := &HMACTokenVerifier{Secret: secret}
+	token := signTestToken(t, secret, Claims{Name: "alice", ExpiresAt: time.Now().Add(-time.Hour).Unix()})
+
+	if _, err := v.Verify(token); err == nil {
+		t.Fatal("expected verification to fail for an expired token")
+	}
+}
+
+func TestHMACTokenVerifierRejectsMissingName(t *testing.T) {
+	secret := []byte("test-secret")
+	v := &HMACTokenVerifier{Secret: secret}
+	token := signTestToken(t, secret, Claims{})
+
+	if _, err := v.Verify(token); err == nil {
+		t.Fatal("expected verification to fail when claims.Name is empty")
+	}
+}
+
+func TestHMACTokenVerifierRejectsMalformedToken(t *testing.T) {
+	v := &HMACTokenVerifier{Secret: []byte("test-secret")}
+	if _, err := v.Verify("not-a-jwt"); err == nil {
+		t.Fatal("expected verification to fail for a malformed token")
+	}
+}
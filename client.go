@@ -0,0 +1,143 @@
+package main
+
+import (
+	"log"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gorilla/websocket"
+)
+
+// Client 是單一 WebSocket 連線在伺服器端的代理，擁有自己的讀取與寫入 goroutine；
+// send 是寫入 goroutine 唯一讀取的 channel；rooms 只由 Hub.run() 這個 goroutine 存取，
+// conn 與 limiter 則由 readPump/writePump 使用。
+type Client struct {
+	hub     *Hub
+	conn    *websocket.Conn
+	send    chan Message
+	name    string
+	rooms   map[string]bool
+	limiter *clientLimiter
+}
+
+// sendBufferSize 是每個 client 寫入 channel 的緩衝大小；超過這個數量還沒被
+// writePump 消化掉的訊息會導致該連線被視為卡住並遭 Hub 丟棄。
+const sendBufferSize = 16
+
+func newClient(hub *Hub, conn *websocket.Conn, name string) *Client {
+	return &Client{
+		hub:     hub,
+		conn:    conn,
+		send:    make(chan Message, sendBufferSize),
+		name:    name,
+		rooms:   make(map[string]bool),
+		limiter: newClientLimiter(),
+	}
+}
+
+// readPump 持續從連線讀取訊息並轉交給 Hub，直到連線關閉或發生錯誤。
+// 每個連線都有獨立的 readPump，因此一個卡住的客戶端不會影響其他連線。
+func (c *Client) readPump() {
+	defer func() {
+		c.hub.unregister <- c
+		c.conn.Close()
+	}()
+
+	c.conn.SetReadLimit(maxMessageBytes)
+	c.conn.SetReadDeadline(time.Now().Add(c.hub.pongWait))
+	c.conn.SetPongHandler(func(string) error {
+		c.conn.SetReadDeadline(time.Now().Add(c.hub.pongWait))
+		return nil
+	})
+
+	for {
+		var msg Message
+		if err := c.conn.ReadJSON(&msg); err != nil {
+			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseAbnormalClosure) {
+				log.Printf("readPump: unexpected close for %s: %v", c.name, err)
+			}
+			return
+		}
+
+		if allowed, abusive := c.limiter.Allow(); !allowed {
+			c.hub.inbound <- clientMessage{client: c, msg: Message{Type: "client_error", Code: "rate_limited"}}
+			if abusive {
+				c.closeWithCode(websocket.ClosePolicyViolation, "rate limit exceeded")
+				return
+			}
+			continue
+		}
+
+		trimmed, ok := sanitizeContent(msg.Type, msg.Content)
+		if !ok {
+			c.hub.inbound <- clientMessage{client: c, msg: Message{Type: "client_error", Code: "invalid_content"}}
+			continue
+		}
+		msg.Content = trimmed
+		msg.Name = c.name
+		c.hub.inbound <- clientMessage{client: c, msg: msg}
+	}
+}
+
+// writePump 是唯一對這個連線呼叫 WriteJSON 的 goroutine：它排空 send channel，
+// 並依照 pingInterval 送出心跳 ping 以偵測半開的連線。
+func (c *Client) writePump() {
+	ticker := time.NewTicker(c.hub.pingInterval)
+	defer func() {
+		ticker.Stop()
+		c.conn.Close()
+	}()
+
+	for {
+		select {
+		case msg, ok := <-c.send:
+			c.conn.SetWriteDeadline(time.Now().Add(c.hub.writeWait))
+			if !ok {
+				c.conn.WriteMessage(websocket.CloseMessage, []byte{})
+				return
+			}
+			if err := c.conn.WriteJSON(msg); err != nil {
+				log.Printf("writePump: error writing to %s: %v", c.name, err)
+				return
+			}
+		case <-ticker.C:
+			c.conn.SetWriteDeadline(time.Now().Add(c.hub.writeWait))
+			if err := c.conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// closeWithCode 送出帶有指定 close code 的 WebSocket 關閉訊框。
+func (c *Client) closeWithCode(code int, reason string) {
+	deadline := time.Now().Add(c.hub.writeWait)
+	c.conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(code, reason), deadline)
+}
+
+// sanitizeContent 裁切過長的內容並確保聊天訊息的內容是非空的合法 UTF-8；
+// 其他訊息類型（如 join_room）不帶 content 也是合法的，因此只檢查 "message" 與 "direct"。
+func sanitizeContent(msgType, content string) (string, bool) {
+	if msgType != "message" && msgType != "direct" {
+		return content, true
+	}
+	if !utf8.ValidString(content) {
+		return "", false
+	}
+	if len(content) > maxMessageBytes {
+		content = trimToRuneBoundary(content, maxMessageBytes)
+	}
+	if content == "" {
+		return "", false
+	}
+	return content, true
+}
+
+// trimToRuneBoundary 把 content 裁切到最多 max 個 byte，並往回退到完整 rune 的
+// 邊界，避免在多位元組字元（例如中文）中間截斷。
+func trimToRuneBoundary(content string, max int) string {
+	for max > 0 && !utf8.RuneStart(content[max]) {
+		max--
+	}
+	return content[:max]
+}
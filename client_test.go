@@ -0,0 +1,64 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestSanitizeContentAllowsNonMessageTypesWithoutContent(t *testing.T) {
+	got, ok := sanitizeContent("join_room", "")
+	if !ok || got != "" {
+		t.Fatalf("join_room with empty content should be valid, got (%q, %v)", got, ok)
+	}
+}
+
+func TestSanitizeContentRejectsEmptyMessage(t *testing.T) {
+	if _, ok := sanitizeContent("message", ""); ok {
+		t.Fatal("empty content should be rejected for type \"message\"")
+	}
+}
+
+func TestSanitizeContentRejectsInvalidUTF8(t *testing.T) {
+	invalid := string([]byte{0xff, 0xfe, 0xfd})
+	if _, ok := sanitizeContent("direct", invalid); ok {
+		t.Fatal("invalid UTF-8 should be rejected")
+	}
+}
+
+func TestSanitizeContentTrimsOverlongMessage(t *testing.T) {
+	long := make([]byte, maxMessageBytes+100)
+	for i := range long {
+		long[i] = 'a'
+	}
+	got, ok := sanitizeContent("message", string(long))
+	if !ok {
+		t.Fatal("expected trimmed content to still be valid")
+	}
+	if len(got) != maxMessageBytes {
+		t.Fatalf("expected trimmed length %d, got %d", maxMessageBytes, len(got))
+	}
+}
+
+func TestSanitizeContentTrimsOverlongMultiByteMessageOnRuneBoundary(t *testing.T) {
+	// "測" 是 3-byte 的 rune，repeat 到超過 maxMessageBytes 後不會整除，
+	// 裁切點必須往回退到完整 rune 的邊界，否則會切斷最後一個字元。
+	long := strings.Repeat("測", maxMessageBytes/3+10)
+	got, ok := sanitizeContent("message", long)
+	if !ok {
+		t.Fatal("expected trimmed multi-byte content to still be valid")
+	}
+	if !utf8.ValidString(got) {
+		t.Fatalf("trimmed content is not valid UTF-8: %q", got)
+	}
+	if len(got) > maxMessageBytes {
+		t.Fatalf("expected trimmed length <= %d, got %d", maxMessageBytes, len(got))
+	}
+}
+
+func TestSanitizeContentPassesThroughValidMessage(t *testing.T) {
+	got, ok := sanitizeContent("message", "hello")
+	if !ok || got != "hello" {
+		t.Fatalf("expected (\"hello\", true), got (%q, %v)", got, ok)
+	}
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"sync"
+	"time"
+)
+
+// HistoryStore 是聊天紀錄的持久化介面，讓 Hub 不需要關心底層是記憶體還是資料庫。
+type HistoryStore interface {
+	Append(ctx context.Context, msg Message) error
+	Recent(ctx context.Context, room string, n int) ([]Message, error)
+	Before(ctx context.Context, room string, beforeID int64, limit int) ([]Message, error)
+}
+
+// MemoryHistoryStore 是預設的 HistoryStore 實作，用固定大小的環狀緩衝區
+// 保存每個房間最近的訊息，伺服器重啟後紀錄即遺失。
+type MemoryHistoryStore struct {
+	mu       sync.Mutex
+	capacity int
+	nextID   int64
+	byRoom   map[string][]Message
+}
+
+// NewMemoryHistoryStore 建立一個每個房間最多保留 capacity 筆訊息的記憶體歷史紀錄儲存。
+func NewMemoryHistoryStore(capacity int) *MemoryHistoryStore {
+	if capacity <= 0 {
+		capacity = 100
+	}
+	return &MemoryHistoryStore{
+		capacity: capacity,
+		byRoom:   make(map[string][]Message),
+	}
+}
+
+// Append 將訊息加入對應房間的環狀緩衝區，超過容量時丟棄最舊的一筆。
+func (s *MemoryHistoryStore) Append(_ context.Context, msg Message) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.nextID++
+	msg.ID = s.nextID
+
+	buf := append(s.byRoom[msg.Room], msg)
+	if len(buf) > s.capacity {
+		buf = buf[len(buf)-s.capacity:]
+	}
+	s.byRoom[msg.Room] = buf
+	return nil
+}
+
+// Recent 回傳某房間最近的 n 筆訊息，由舊到新排序。
+func (s *MemoryHistoryStore) Recent(_ context.Context, room string, n int) ([]Message, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	buf := s.byRoom[room]
+	if n <= 0 || n > len(buf) {
+		n = len(buf)
+	}
+	out := make([]Message, n)
+	copy(out, buf[len(buf)-n:])
+	return out, nil
+}
+
+// Before 回傳某房間中 ID 小於 beforeID 的訊息，最多 limit 筆，由舊到新排序，
+// 供客戶端透過 fetch_history 向更早的歷史紀錄翻頁。
+func (s *MemoryHistoryStore) Before(_ context.Context, room string, beforeID int64, limit int) ([]Message, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	buf := s.byRoom[room]
+	matched := make([]Message, 0, limit)
+	for i := len(buf) - 1; i >= 0 && len(matched) < limit; i-- {
+		if beforeID == 0 || buf[i].ID < beforeID {
+			matched = append(matched, buf[i])
+		}
+	}
+	// matched 目前是新到舊，反轉成舊到新以符合 Recent 的慣例
+	for i, j := 0, len(matched)-1; i < j; i, j = i+1, j-1 {
+		matched[i], matched[j] = matched[j], matched[i]
+	}
+	return matched, nil
+}
+
+// SQLHistoryStore 是以 database/sql 存取關聯式資料庫的 HistoryStore 實作，
+// 預期存在一張 messages(id, room, sender, content, created_at) 資料表。
+type SQLHistoryStore struct {
+	db *sql.DB
+}
+
+// NewSQLHistoryStore 包裝一個已開啟的 *sql.DB，呼叫端負責建表與連線生命週期管理。
+func NewSQLHistoryStore(db *sql.DB) *SQLHistoryStore {
+	return &SQLHistoryStore{db: db}
+}
+
+// Append 將訊息寫入 messages 資料表。
+func (s *SQLHistoryStore) Append(ctx context.Context, msg Message) error {
+	createdAt := time.Now()
+	if msg.CreatedAt != nil {
+		createdAt = *msg.CreatedAt
+	}
+	_, err := s.db.ExecContext(ctx,
+		`INSERT INTO messages (room, sender, content, created_at) VALUES (?, ?, ?, ?)`,
+		msg.Room, msg.Name, msg.Content, createdAt,
+	)
+	return err
+}
+
+// Recent 查詢某房間最近的 n 筆訊息，由舊到新排序。
+func (s *SQLHistoryStore) Recent(ctx context.Context, room string, n int) ([]Message, error) {
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT id, room, sender, content, created_at FROM messages
+		 WHERE room = ? ORDER BY id DESC LIMIT ?`,
+		room, n,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	return scanMessagesReversed(rows)
+}
+
+// Before 查詢某房間 ID 小於 beforeID 的訊息，最多 limit 筆，由舊到新排序。
+func (s *SQLHistoryStore) Before(ctx context.Context, room string, beforeID int64, limit int) ([]Message, error) {
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT id, room, sender, content, created_at FROM messages
+		 WHERE room = ? AND (? = 0 OR id < ?) ORDER BY id DESC LIMIT ?`,
+		room, beforeID, beforeID, limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	return scanMessagesReversed(rows)
+}
+
+func scanMessagesReversed(rows *sql.Rows) ([]Message, error) {
+	var msgs []Message
+	for rows.Next() {
+		var m Message
+		var createdAt time.Time
+		if err := rows.Scan(&m.ID, &m.Room, &m.Name, &m.Content, &createdAt); err != nil {
+			return nil, err
+		}
+		m.Type = "message"
+		m.CreatedAt = &createdAt
+		msgs = append(msgs, m)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	for i, j := 0, len(msgs)-1; i < j; i, j = i+1, j-1 {
+		msgs[i], msgs[j] = msgs[j], msgs[i]
+	}
+	return msgs, nil
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"context"
+	"testing"
+)
+
+func TestMemoryHistoryStoreRecentReturnsOldestToNewest(t *testing.T) {
+	s := NewMemoryHistoryStore(10)
+	ctx := context.Background()
+	for _, content := range []string{"a", "b", "c"} {
+		if err := s.Append(ctx, Message{Room: "general", Content: content}); err != nil {
+			t.Fatalf("append: %v", err)
+		}
+	}
+
+	got, err := s.Recent(ctx, "general", 2)
+	if err != nil {
+		t.Fatalf("recent: %v", err)
+	}
+	if len(got) != 2 || got[0].Content != "b" || got[1].Content != "c" {
+		t.Fatalf("expected [b c], got %v", got)
+	}
+}
+
+func TestMemoryHistoryStoreRecentTrimsToCapacity(t *testing.T) {
+	s := NewMemoryHistoryStore(2)
+	ctx := context.Background()
+	for _, content := range []string{"a", "b", "c"} {
+		s.Append(ctx, Message{Room: "general", Content: content})
+	}
+
+	got, err := s.Recent(ctx, "general", 10)
+	if err != nil {
+		t.Fatalf("recent: %v", err)
+	}
+	if len(got) != 2 || got[0].Content != "b" || got[1].Content != "c" {
+		t.Fatalf("expected ring buffer to keep only the last 2 entries, got %v", got)
+	}
+}
+
+func TestMemoryHistoryStoreBeforePagesBackwards(t *testing.T) {
+	s := NewMemoryHistoryStore(10)
+	ctx := context.Background()
+	for _, content := range []string{"a", "b", "c", "d"} {
+		s.Append(ctx, Message{Room: "general", Content: content})
+	}
+
+	recent, err := s.Recent(ctx, "general", 1)
+	if err != nil || len(recent) != 1 {
+		t.Fatalf("recent: %v %v", recent, err)
+	}
+	lastID := recent[0].ID
+
+	page, err := s.Before(ctx, "general", lastID, 2)
+	if err != nil {
+		t.Fatalf("before: %v", err)
+	}
+	if len(page) != 2 || page[0].Content != "b" || page[1].Content != "c" {
+		t.Fatalf("expected [b c] before %q, got %v", "d", page)
+	}
+}
+
+func TestMemoryHistoryStoreIsolatesRooms(t *testing.T) {
+	s := NewMemoryHistoryStore(10)
+	ctx := context.Background()
+	s.Append(ctx, Message{Room: "general", Content: "hello"})
+	s.Append(ctx, Message{Room: "random", Content: "world"})
+
+	got, err := s.Recent(ctx, "general", 10)
+	if err != nil {
+		t.Fatalf("recent: %v", err)
+	}
+	if len(got) != 1 || got[0].Content != "hello" {
+		t.Fatalf("expected only general's messages, got %v", got)
+	}
+}
@@ -0,0 +1,310 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+)
+
+// ErrDuplicateName 表示升級連線時要求的使用者名稱已經在線，拒絕加入以保證 direct 訊息的路由不會有歧義。
+var ErrDuplicateName = errors.New("hub: name already in use")
+
+const (
+	historyReplayCount = 50  // 加入房間時回補的歷史訊息筆數
+	historyCapacity    = 500 // MemoryHistoryStore 每個房間保留的訊息上限
+)
+
+// Room 代表一個聊天室，擁有自己的連線集合；所有欄位只能由 Hub.run() 這個
+// goroutine 存取與修改，藉此避免額外的鎖。
+type Room struct {
+	name    string
+	clients map[*Client]bool
+}
+
+func newRoom(name string) *Room {
+	return &Room{name: name, clients: make(map[*Client]bool)}
+}
+
+func (r *Room) info() RoomInfo {
+	return RoomInfo{Name: r.name, MemberCount: len(r.clients)}
+}
+
+// clientMessage 把一則已讀取的客戶端訊息連同其來源 Client 一起送進 Hub，
+// 讓 Hub.run() 能在單一 goroutine 內完成所有狀態變更。
+type clientMessage struct {
+	client *Client
+	msg    Message
+}
+
+// registerRequest 是升級連線時送給 Hub 的加入申請，result 會回報使用者名稱
+// 是否被接受（nil）或遭拒（例如 ErrDuplicateName）。
+type registerRequest struct {
+	client *Client
+	result chan error
+}
+
+// Hub 是整個伺服器的中樞：它擁有所有房間與連線狀態，並透過 run() 這個
+// 單一 goroutine 序列化所有的 map 存取，取代原本用 sync.Mutex 保護的全域變數。
+type Hub struct {
+	register   chan registerRequest
+	unregister chan *Client
+	inbound    chan clientMessage
+	listRooms  chan chan []RoomInfo // GET /rooms 用來同步查詢房間列表，不經過 clientMessage
+
+	clients map[*Client]bool   // 所有已連線的 client（不分房間）
+	byName  map[string]*Client // 依使用者名稱索引，供 direct 訊息與唯一性檢查使用
+	rooms   map[string]*Room
+
+	history HistoryStore
+
+	pingInterval time.Duration // 伺服器發送 ping 的間隔
+	pongWait     time.Duration // 等待 pong 回應的時限
+	writeWait    time.Duration // 單次 WriteJSON 的時限
+}
+
+// NewHub 建立一個尚未啟動的 Hub，呼叫端需另外呼叫 go hub.run()。
+func NewHub(history HistoryStore) *Hub {
+	return &Hub{
+		register:     make(chan registerRequest),
+		unregister:   make(chan *Client),
+		inbound:      make(chan clientMessage),
+		listRooms:    make(chan chan []RoomInfo),
+		clients:      make(map[*Client]bool),
+		byName:       make(map[string]*Client),
+		rooms:        make(map[string]*Room),
+		history:      history,
+		pingInterval: 54 * time.Second,
+		pongWait:     60 * time.Second,
+		writeWait:    10 * time.Second,
+	}
+}
+
+// run 是 Hub 狀態機的唯一擁有者，所有的 map 讀寫都只在這個 goroutine 裡發生。
+func (h *Hub) run() {
+	for {
+		select {
+		case req := <-h.register:
+			h.handleRegister(req)
+		case c := <-h.unregister:
+			h.handleUnregister(c)
+		case cm := <-h.inbound:
+			h.handleInbound(cm.client, cm.msg)
+		case reply := <-h.listRooms:
+			reply <- h.roomList()
+		}
+	}
+}
+
+// roomList 回傳目前所有房間的名稱與成員數，供 sendRoomList 與 GET /rooms 共用。
+func (h *Hub) roomList() []RoomInfo {
+	rooms := make([]RoomInfo, 0, len(h.rooms))
+	for _, room := range h.rooms {
+		rooms = append(rooms, room.info())
+	}
+	return rooms
+}
+
+func (h *Hub) handleRegister(req registerRequest) {
+	c := req.client
+	if _, taken := h.byName[c.name]; taken {
+		req.result <- ErrDuplicateName
+		return
+	}
+	h.clients[c] = true
+	h.byName[c.name] = c
+	req.result <- nil
+
+	h.send(c, Message{Type: "online_users", Users: h.onlineUsers()})
+	h.broadcastOnlineUsers()
+}
+
+func (h *Hub) handleUnregister(c *Client) {
+	if !h.clients[c] {
+		return
+	}
+	delete(h.clients, c)
+	if h.byName[c.name] == c {
+		delete(h.byName, c.name)
+	}
+	for room := range c.rooms {
+		h.leaveRoom(c, room, true)
+	}
+	close(c.send)
+	h.broadcastOnlineUsers()
+}
+
+// onlineUsers 回傳目前所有已連線（跨房間）的使用者名稱。
+func (h *Hub) onlineUsers() []string {
+	users := make([]string, 0, len(h.byName))
+	for name := range h.byName {
+		users = append(users, name)
+	}
+	return users
+}
+
+// broadcastOnlineUsers 把目前全站在線用戶列表發送給每一個已連線的 client。
+func (h *Hub) broadcastOnlineUsers() {
+	msg := Message{Type: "online_users", Users: h.onlineUsers()}
+	for c := range h.clients {
+		h.send(c, msg)
+	}
+}
+
+func (h *Hub) handleInbound(c *Client, msg Message) {
+	switch msg.Type {
+	case "client_error":
+		h.send(c, Message{Type: "error", Code: msg.Code})
+	case "join_room":
+		h.joinRoom(c, msg.Room)
+	case "leave_room":
+		h.leaveRoom(c, msg.Room, false)
+	case "create_room":
+		h.createRoom(msg.Room)
+	case "list_rooms":
+		h.sendRoomList(c)
+	case "room_users":
+		h.sendRoomUsers(c, msg.Room)
+	case "fetch_history":
+		h.sendHistoryPage(c, msg.Room, msg.BeforeID, msg.Limit)
+	case "direct":
+		h.routeDirect(c, msg)
+	case "message":
+		h.broadcastToRoom(msg)
+	default:
+		log.Printf("hub: unknown message type %q from %s", msg.Type, c.name)
+	}
+}
+
+func (h *Hub) createRoom(name string) {
+	if name == "" {
+		return
+	}
+	if _, ok := h.rooms[name]; !ok {
+		h.rooms[name] = newRoom(name)
+	}
+}
+
+func (h *Hub) joinRoom(c *Client, name string) {
+	if name == "" {
+		return
+	}
+	h.createRoom(name)
+	room := h.rooms[name]
+	room.clients[c] = true
+	c.rooms[name] = true
+
+	if h.history != nil {
+		recent, err := h.history.Recent(context.Background(), name, historyReplayCount)
+		if err != nil {
+			log.Printf("hub: loading history for room %q: %v", name, err)
+		} else {
+			h.send(c, Message{Type: "history", Room: name, History: recent})
+		}
+	}
+
+	h.broadcastToRoom(Message{Type: "join", Room: name, Content: c.name + " 加入了聊天室"})
+	h.sendRoomUsersToRoom(name)
+}
+
+func (h *Hub) leaveRoom(c *Client, name string, silent bool) {
+	room, ok := h.rooms[name]
+	if !ok || !room.clients[c] {
+		return
+	}
+	delete(room.clients, c)
+	delete(c.rooms, name)
+
+	if !silent {
+		h.broadcastToRoom(Message{Type: "leave", Room: name, Content: c.name + " 離開了聊天室"})
+	}
+	h.sendRoomUsersToRoom(name)
+}
+
+func (h *Hub) sendRoomList(c *Client) {
+	h.send(c, Message{Type: "list_rooms", Rooms: h.roomList()})
+}
+
+func (h *Hub) sendRoomUsers(c *Client, name string) {
+	room, ok := h.rooms[name]
+	if !ok {
+		h.send(c, Message{Type: "error", Code: "room_not_found", Room: name})
+		return
+	}
+	h.send(c, roomUsersMessage(room))
+}
+
+func (h *Hub) sendRoomUsersToRoom(name string) {
+	room, ok := h.rooms[name]
+	if !ok {
+		return
+	}
+	h.broadcastToRoom(roomUsersMessage(room))
+}
+
+func roomUsersMessage(room *Room) Message {
+	users := make([]string, 0, len(room.clients))
+	for c := range room.clients {
+		users = append(users, c.name)
+	}
+	return Message{Type: "room_users", Room: room.name, Users: users}
+}
+
+func (h *Hub) sendHistoryPage(c *Client, room string, beforeID int64, limit int) {
+	if h.history == nil {
+		h.send(c, Message{Type: "error", Code: "history_unavailable", Room: room})
+		return
+	}
+	if limit <= 0 {
+		limit = historyReplayCount
+	}
+	page, err := h.history.Before(context.Background(), room, beforeID, limit)
+	if err != nil {
+		log.Printf("hub: fetching history page for room %q: %v", room, err)
+		h.send(c, Message{Type: "error", Code: "history_unavailable", Room: room})
+		return
+	}
+	h.send(c, Message{Type: "history", Room: room, History: page})
+}
+
+// broadcastToRoom 把訊息發給 msg.Room 裡的每個成員，並視需要附加到歷史紀錄。
+func (h *Hub) broadcastToRoom(msg Message) {
+	room, ok := h.rooms[msg.Room]
+	if !ok {
+		return
+	}
+	if h.history != nil && msg.Type == "message" {
+		now := time.Now()
+		msg.CreatedAt = &now
+		if err := h.history.Append(context.Background(), msg); err != nil {
+			log.Printf("hub: appending history for room %q: %v", msg.Room, err)
+		}
+	}
+	for c := range room.clients {
+		h.send(c, msg)
+	}
+}
+
+// routeDirect 把一則 direct 訊息送給收件者並回送一份給寄件者；收件者離線時回覆錯誤訊息。
+func (h *Hub) routeDirect(from *Client, msg Message) {
+	msg.Name = from.name
+	to, ok := h.byName[msg.To]
+	if !ok {
+		h.send(from, Message{Type: "error", Code: "user_offline", To: msg.To})
+		return
+	}
+	h.send(to, msg)
+	h.send(from, msg)
+}
+
+// send 把訊息塞進 client 的 send channel；channel 已滿（慢速客戶端）時直接丟棄該連線，
+// 避免一個卡住的連線拖垮整個 Hub。
+func (h *Hub) send(c *Client, msg Message) {
+	select {
+	case c.send <- msg:
+	default:
+		log.Printf("hub: send buffer full for %s, dropping client", c.name)
+		go func() { h.unregister <- c }()
+		c.conn.Close()
+	}
+}
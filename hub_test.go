@@ -0,0 +1,239 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// newTestHub 啟動一個帶記憶體歷史紀錄的 Hub 供測試使用。
+func newTestHub(t *testing.T) *Hub {
+	t.Helper()
+	h := NewHub(NewMemoryHistoryStore(historyCapacity))
+	go h.run()
+	return h
+}
+
+// newTestClient 透過一個真正的 WebSocket handshake 取得伺服器端的 *websocket.Conn，
+// 包成一個未啟動 readPump/writePump 的 Client，讓測試能直接操作 c.send 並驗證 Hub
+// 的行為，而不必依賴完整的 main.go 連線流程。
+func newTestClient(t *testing.T, hub *Hub, name string) *Client {
+	t.Helper()
+
+	serverConn := make(chan *websocket.Conn, 1)
+	upgrader := websocket.Upgrader{CheckOrigin: func(*http.Request) bool { return true }}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			t.Errorf("upgrade: %v", err)
+			return
+		}
+		serverConn <- conn
+	}))
+	t.Cleanup(srv.Close)
+
+	wsURL := "ws" + strings.TrimPrefix(srv.URL, "http")
+	clientConn, _, err := websocket.DefaultDialer.Dial(wsURL, nil)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	t.Cleanup(func() { clientConn.Close() })
+
+	conn := <-serverConn
+	return newClient(hub, conn, name)
+}
+
+// register 同步地向 Hub 申請加入，並回傳 Hub 的結果（nil 或拒絕原因），由呼叫端自行判斷。
+func register(t *testing.T, hub *Hub, c *Client) error {
+	t.Helper()
+	result := make(chan error, 1)
+	hub.register <- registerRequest{client: c, result: result}
+	return <-result
+}
+
+// drain 消耗 c.send 上緊接著的一則訊息，逾時則讓測試失敗。
+func drain(t *testing.T, c *Client) Message {
+	t.Helper()
+	select {
+	case msg := <-c.send:
+		return msg
+	case <-time.After(time.Second):
+		t.Fatalf("timed out waiting for a message on %s's send channel", c.name)
+		return Message{}
+	}
+}
+
+// drainType 一直消耗 c.send 直到看到指定類型的訊息（用來跳過事先已知會收到的
+// online_users / room_users 等通知），逾時則讓測試失敗。
+func drainType(t *testing.T, c *Client, msgType string) Message {
+	t.Helper()
+	for i := 0; i < 10; i++ {
+		msg := drain(t, c)
+		if msg.Type == msgType {
+			return msg
+		}
+	}
+	t.Fatalf("never saw a %q message on %s's send channel", msgType, c.name)
+	return Message{}
+}
+
+// drainAll 非阻塞地清空 c.send 目前已經排隊的訊息，用來在斷言「之後不該再收到
+// 任何訊息」之前，先把既有的 setup 通知（如 online_users）清掉。
+func drainAll(c *Client) {
+	for {
+		select {
+		case <-c.send:
+		default:
+			return
+		}
+	}
+}
+
+func assertNoMessage(t *testing.T, c *Client) {
+	t.Helper()
+	select {
+	case msg := <-c.send:
+		t.Fatalf("expected no message for %s, got %+v", c.name, msg)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestHubRegisterAddsClientAndBroadcastsOnlineUsers(t *testing.T) {
+	hub := newTestHub(t)
+	alice := newTestClient(t, hub, "alice")
+
+	if err := register(t, hub, alice); err != nil {
+		t.Fatalf("expected registration to succeed, got %v", err)
+	}
+
+	msg := drainType(t, alice, "online_users")
+	if len(msg.Users) != 1 || msg.Users[0] != "alice" {
+		t.Fatalf("expected online_users [alice], got %v", msg.Users)
+	}
+}
+
+func TestHubRejectsDuplicateName(t *testing.T) {
+	hub := newTestHub(t)
+	alice1 := newTestClient(t, hub, "alice")
+	alice2 := newTestClient(t, hub, "alice")
+
+	if err := register(t, hub, alice1); err != nil {
+		t.Fatalf("expected first registration to succeed, got %v", err)
+	}
+	if err := register(t, hub, alice2); err != ErrDuplicateName {
+		t.Fatalf("expected ErrDuplicateName for the second \"alice\", got %v", err)
+	}
+}
+
+func TestHubRoomBroadcastIsScopedToMembers(t *testing.T) {
+	hub := newTestHub(t)
+	alice := newTestClient(t, hub, "alice")
+	bob := newTestClient(t, hub, "bob")
+
+	register(t, hub, alice)
+	register(t, hub, bob)
+
+	hub.inbound <- clientMessage{client: alice, msg: Message{Type: "join_room", Room: "general"}}
+	hub.inbound <- clientMessage{client: bob, msg: Message{Type: "join_room", Room: "random"}}
+
+	drainType(t, alice, "join") // alice 自己加入 general 的通知
+
+	hub.inbound <- clientMessage{client: alice, msg: Message{Type: "message", Room: "general", Content: "hi"}}
+
+	got := drainType(t, alice, "message")
+	if got.Content != "hi" || got.Room != "general" {
+		t.Fatalf("expected alice to receive her own room message, got %+v", got)
+	}
+
+	drainAll(bob)           // 清掉 bob 自己加入 "random" 房間時產生的通知
+	assertNoMessage(t, bob) // bob 在不同房間，不該收到 general 的廣播
+}
+
+func TestHubRoutesDirectMessageToRecipientAndEchoesSender(t *testing.T) {
+	hub := newTestHub(t)
+	alice := newTestClient(t, hub, "alice")
+	bob := newTestClient(t, hub, "bob")
+
+	register(t, hub, alice)
+	register(t, hub, bob)
+
+	hub.inbound <- clientMessage{client: alice, msg: Message{Type: "direct", To: "bob", Content: "psst"}}
+
+	toBob := drainType(t, bob, "direct")
+	if toBob.Content != "psst" || toBob.Name != "alice" {
+		t.Fatalf("expected bob to receive alice's direct message, got %+v", toBob)
+	}
+
+	echoed := drainType(t, alice, "direct")
+	if echoed.Content != "psst" || echoed.To != "bob" {
+		t.Fatalf("expected alice to receive an echo of her direct message, got %+v", echoed)
+	}
+}
+
+func TestHubDirectMessageToOfflineUserRepliesWithError(t *testing.T) {
+	hub := newTestHub(t)
+	alice := newTestClient(t, hub, "alice")
+	register(t, hub, alice)
+
+	hub.inbound <- clientMessage{client: alice, msg: Message{Type: "direct", To: "ghost", Content: "hi"}}
+
+	got := drainType(t, alice, "error")
+	if got.Code != "user_offline" {
+		t.Fatalf("expected code user_offline, got %q", got.Code)
+	}
+}
+
+func TestHubDropsSlowClientInsteadOfBlockingBroadcast(t *testing.T) {
+	hub := newTestHub(t)
+	slow := newTestClient(t, hub, "slow")
+	fast := newTestClient(t, hub, "fast")
+
+	register(t, hub, slow)
+	register(t, hub, fast)
+
+	hub.inbound <- clientMessage{client: slow, msg: Message{Type: "join_room", Room: "general"}}
+	hub.inbound <- clientMessage{client: fast, msg: Message{Type: "join_room", Room: "general"}}
+
+	// slow 從不消耗 c.send；fast 在每次送出後立刻（非阻塞地）排空自己的 channel，
+	// 模擬一個正常運作的 writePump。灌爆 slow 的緩衝區（sendBufferSize）之後，
+	// Hub 自己的廣播迴圈不能被它卡住——它應該被踢出去，而不是讓下面這個迴圈 deadlock，
+	// 而且 fast 不該因為 slow 卡住而被連帶犧牲。
+	received := 0
+	const messages = sendBufferSize + 20
+	for i := 0; i < messages; i++ {
+		hub.inbound <- clientMessage{client: fast, msg: Message{Type: "message", Room: "general", Content: "spam"}}
+		select {
+		case <-fast.send:
+			received++
+		default:
+		}
+	}
+
+	// 給 Hub 一點時間處理非同步的 unregister（h.send 逐出時是用 go func 送出的）。
+	deadline := time.After(2 * time.Second)
+	for {
+		result := make(chan []RoomInfo, 1)
+		hub.listRooms <- result
+		<-result // 只是確保 Hub 的 run() 還活著、沒有卡住
+
+		if _, stillThere := hub.byName["slow"]; !stillThere {
+			break
+		}
+		select {
+		case <-deadline:
+			t.Fatal("timed out waiting for the slow client to be evicted")
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+
+	if _, ok := hub.byName["fast"]; !ok {
+		t.Fatal("fast, which kept draining its channel, should not have been evicted")
+	}
+	if received == 0 {
+		t.Fatal("expected fast to have received at least some of the broadcast messages")
+	}
+}
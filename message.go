@@ -0,0 +1,26 @@
+package main
+
+import "time"
+
+// Message 是所有 WebSocket 訊息的共用信封格式，Type 決定其餘欄位如何解讀。
+type Message struct {
+	Type      string     `json:"type"`                 // 消息類型："message", "join", "leave", "online_users", "history", "direct", "error", "create_room", "join_room", "leave_room", "list_rooms", "room_users", "fetch_history"
+	Name      string     `json:"name"`                 // 發送者的名稱
+	Content   string     `json:"content"`              // 消息的內容
+	Users     []string   `json:"users,omitempty"`      // 用於傳送在線用戶列表（room_users / online_users）
+	Room      string     `json:"room,omitempty"`       // 此訊息所屬的聊天室名稱
+	Rooms     []RoomInfo `json:"rooms,omitempty"`      // list_rooms 回應時使用的房間清單
+	To        string     `json:"to,omitempty"`         // direct 訊息的目標接收者名稱
+	History   []Message  `json:"history,omitempty"`    // history 回應夾帶的歷史訊息列表
+	BeforeID  int64      `json:"before_id,omitempty"`  // fetch_history 分頁游標，取得此 ID 之前的訊息
+	Limit     int        `json:"limit,omitempty"`      // fetch_history 想取得的筆數上限
+	Code      string     `json:"code,omitempty"`       // error 訊息的機器可讀錯誤代碼，例如 "user_offline"
+	ID        int64      `json:"id,omitempty"`         // 訊息在歷史紀錄中的序號，供 fetch_history 分頁使用
+	CreatedAt *time.Time `json:"created_at,omitempty"` // 訊息建立時間；time.Time 本身 omitempty 無效，故用指標
+}
+
+// RoomInfo 是 GET /rooms 與 list_rooms 回應中描述單一房間的摘要資訊。
+type RoomInfo struct {
+	Name        string `json:"name"`         // 房間名稱
+	MemberCount int    `json:"member_count"` // 目前房間內的連線數
+}
@@ -0,0 +1,34 @@
+package main
+
+import "golang.org/x/time/rate"
+
+const (
+	maxMessageBytes    = 4 * 1024 // SetReadLimit 預設值：單一訊息最大 4 KiB
+	rateLimitPerSecond = 5        // 每秒允許的訊息數
+	rateLimitBurst     = 10       // 允許短暫超出 rateLimitPerSecond 的額度
+	maxRateViolations  = 3        // 違規次數達到這個值就直接關閉連線
+)
+
+// clientLimiter 包裝 token-bucket 限速器，並記錄違規次數，
+// 達到 maxRateViolations 後呼叫端應關閉連線以阻斷濫用的客戶端。
+type clientLimiter struct {
+	limiter    *rate.Limiter
+	violations int
+}
+
+// newClientLimiter 建立一個預設每秒 rateLimitPerSecond 筆、可爆發 rateLimitBurst 筆的限速器。
+func newClientLimiter() *clientLimiter {
+	return &clientLimiter{
+		limiter: rate.NewLimiter(rate.Limit(rateLimitPerSecond), rateLimitBurst),
+	}
+}
+
+// Allow 回報這次訊息是否在速率限制內，並在超限時累計違規次數。
+// abusive 為 true 時代表違規次數已達到 maxRateViolations，呼叫端應關閉連線。
+func (c *clientLimiter) Allow() (allowed bool, abusive bool) {
+	if c.limiter.Allow() {
+		return true, false
+	}
+	c.violations++
+	return false, c.violations >= maxRateViolations
+}
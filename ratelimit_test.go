@@ -0,0 +1,40 @@
+package main
+
+import "testing"
+
+func TestClientLimiterAllowsWithinBurst(t *testing.T) {
+	l := newClientLimiter()
+	for i := 0; i < rateLimitBurst; i++ {
+		if allowed, _ := l.Allow(); !allowed {
+			t.Fatalf("request %d: expected allowed within burst of %d", i, rateLimitBurst)
+		}
+	}
+}
+
+func TestClientLimiterRejectsOverBurst(t *testing.T) {
+	l := newClientLimiter()
+	for i := 0; i < rateLimitBurst; i++ {
+		l.Allow()
+	}
+	allowed, abusive := l.Allow()
+	if allowed {
+		t.Fatal("expected the request past the burst to be rejected")
+	}
+	if abusive {
+		t.Fatal("a single violation should not yet be abusive")
+	}
+}
+
+func TestClientLimiterReportsAbusiveAfterMaxViolations(t *testing.T) {
+	l := newClientLimiter()
+	for i := 0; i < rateLimitBurst; i++ {
+		l.Allow()
+	}
+	var abusive bool
+	for i := 0; i < maxRateViolations; i++ {
+		_, abusive = l.Allow()
+	}
+	if !abusive {
+		t.Fatalf("expected abusive after %d violations", maxRateViolations)
+	}
+}